@@ -0,0 +1,180 @@
+package lfs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// pathPattern is a single compiled gitignore/gitattributes-style path
+// pattern, e.g. "**/*.psd", "assets/**/raw/**", "!keepme.bin" or "build/".
+type pathPattern struct {
+	raw      string
+	negate   bool
+	anchored bool
+	dirOnly  bool
+	segments []string
+}
+
+// compilePattern parses a single pattern line into a pathPattern, splitting
+// it into the segments matchSegments() walks. This only has to happen once
+// per pattern, no matter how many paths are later tested against it.
+func compilePattern(raw string) *pathPattern {
+	p := &pathPattern{raw: raw}
+
+	pattern := raw
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	if strings.HasPrefix(pattern, "/") {
+		p.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else if strings.Contains(pattern, "/") {
+		// A slash anywhere but the end anchors the pattern to the root,
+		// same as git's own ignore-matching rules.
+		p.anchored = true
+	}
+
+	// gitignore-style classes negate with "[!...]"; filepath.Match only
+	// understands the "[^...]" form, so translate before compiling.
+	pattern = strings.Replace(pattern, "[!", "[^", -1)
+
+	p.segments = strings.Split(pattern, "/")
+	return p
+}
+
+// Match reports whether path, a slash-separated path relative to the root
+// being filtered, matches this pattern. isDir should be true when path
+// names a directory. A "directory-only" pattern (a trailing "/") never
+// matches the path itself unless isDir is true, but it always matches
+// paths beneath a directory it matches, regardless of isDir, since
+// excluding a directory excludes everything in it.
+func (p *pathPattern) Match(path string, isDir bool) bool {
+	segments := strings.Split(path, "/")
+
+	if p.anchored {
+		matched, exact := matchSegments(p.segments, segments)
+		return matched && !(p.dirOnly && exact && !isDir)
+	}
+
+	// An unanchored pattern (no slash except possibly a trailing one) may
+	// match starting at any path segment, not just the root.
+	for i := range segments {
+		matched, exact := matchSegments(p.segments, segments[i:])
+		if matched && !(p.dirOnly && exact && !isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches a compiled pattern's segments, which may contain a
+// "**" segment matching zero or more path segments, against a path's
+// segments. It reports both whether the pattern matched, and whether that
+// match was exact, i.e. consumed the path's final segment, as opposed to
+// matching only a leading portion of it (a directory containing path).
+func matchSegments(pattern, path []string) (matched, exact bool) {
+	if len(pattern) == 0 {
+		// The pattern matched a leading portion of the path. Per
+		// gitignore semantics a pattern that matches a directory also
+		// matches everything beneath it, so any leftover path segments
+		// are still considered a match, just not an exact one.
+		return true, len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return true, len(path) == 0
+		}
+		for i := 0; i <= len(path); i++ {
+			if m, e := matchSegments(pattern[1:], path[i:]); m {
+				return true, e
+			}
+		}
+		return false, false
+	}
+
+	if len(path) == 0 {
+		return false, false
+	}
+
+	if ok, err := filepath.Match(pattern[0], path[0]); err != nil || !ok {
+		return false, false
+	}
+
+	return matchSegments(pattern[1:], path[1:])
+}
+
+// PathFilter is a compiled, reusable set of include and exclude patterns.
+// Callers that test many paths against the same include/exclude lists
+// (commands, the directory scanner, the transfer queue) should compile one
+// PathFilter with NewPathFilter and reuse it, rather than re-parsing the
+// pattern strings for every path.
+type PathFilter struct {
+	include []*pathPattern
+	exclude []*pathPattern
+}
+
+// NewPathFilter compiles includePaths and excludePaths into a PathFilter.
+// An empty includePaths always passes the include side of the filter, and
+// likewise an empty excludePaths always passes the exclude side.
+func NewPathFilter(includePaths, excludePaths []string) *PathFilter {
+	return &PathFilter{
+		include: compilePatterns(includePaths),
+		exclude: compilePatterns(excludePaths),
+	}
+}
+
+func compilePatterns(raw []string) []*pathPattern {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	patterns := make([]*pathPattern, len(raw))
+	for i, r := range raw {
+		patterns[i] = compilePattern(r)
+	}
+	return patterns
+}
+
+// Allows reports whether path, a filename or directory path using either
+// path separator, passes the filter. Patterns are evaluated in the order
+// they were given, so a later "!" pattern can re-include a path an earlier
+// pattern excluded.
+func (f *PathFilter) Allows(path string) bool {
+	return f.AllowsDir(path, false)
+}
+
+// AllowsDir is like Allows, but isDir should be set to true when path names
+// a directory so that directory-only patterns (a trailing "/") apply.
+func (f *PathFilter) AllowsDir(path string, isDir bool) bool {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return true
+	}
+
+	path = filepath.ToSlash(path)
+
+	included := len(f.include) == 0
+	for _, inc := range f.include {
+		if inc.Match(path, isDir) {
+			included = !inc.negate
+		}
+	}
+	if !included {
+		return false
+	}
+
+	excluded := false
+	for _, ex := range f.exclude {
+		if ex.Match(path, isDir) {
+			excluded = !ex.negate
+		}
+	}
+	return !excluded
+}
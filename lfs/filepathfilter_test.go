@@ -0,0 +1,182 @@
+package lfs
+
+import "testing"
+
+func TestPathFilterAllows(t *testing.T) {
+	cases := []struct {
+		desc     string
+		include  []string
+		exclude  []string
+		path     string
+		expected bool
+	}{
+		{"no filters", nil, nil, "a.txt", true},
+
+		{"simple include match", []string{"*.txt"}, nil, "a.txt", true},
+		{"simple include mismatch", []string{"*.txt"}, nil, "a.psd", false},
+
+		{"simple exclude match", nil, []string{"*.psd"}, "a.psd", false},
+		{"simple exclude mismatch", nil, []string{"*.psd"}, "a.txt", true},
+
+		{"recursive glob matches nested file", []string{"**/*.psd"}, nil, "assets/raw/a.psd", true},
+		{"recursive glob matches top-level file", []string{"**/*.psd"}, nil, "a.psd", true},
+
+		{"recursive glob in middle", []string{"assets/**/raw/**"}, nil, "assets/x/y/raw/a.psd", true},
+		{"recursive glob in middle mismatch", []string{"assets/**/raw/**"}, nil, "other/x/y/raw/a.psd", false},
+
+		{"leading anchor matches only at root", []string{"/build"}, nil, "build", true},
+		{"leading anchor does not match nested", []string{"/build"}, nil, "sub/build", false},
+
+		{"unanchored matches at any depth", []string{"build"}, nil, "sub/build", true},
+
+		{"trailing slash is directory only", []string{"build/"}, nil, "build", false},
+
+		{"negation re-includes a file", []string{"*"}, []string{"*.bin", "!keepme.bin"}, "keepme.bin", true},
+		{"negation does not affect other files", []string{"*"}, []string{"*.bin", "!keepme.bin"}, "other.bin", false},
+
+		{"parent directory without wildcard still matches", []string{"assets"}, nil, "assets/a.psd", true},
+
+		{"character class", []string{"file[0-9].txt"}, nil, "file1.txt", true},
+		{"character class negation", []string{"file[!0-9].txt"}, nil, "filea.txt", true},
+		{"character class negation mismatch", []string{"file[!0-9].txt"}, nil, "file1.txt", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			filter := NewPathFilter(c.include, c.exclude)
+			if actual := filter.Allows(c.path); actual != c.expected {
+				t.Errorf("expected Allows(%q) = %v, got %v", c.path, c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPathFilterDirectoryOnly(t *testing.T) {
+	filter := NewPathFilter(nil, []string{"build/"})
+
+	if !filter.AllowsDir("build", false) {
+		t.Error("expected a file named build to still be allowed")
+	}
+	if filter.AllowsDir("build", true) {
+		t.Error("expected a directory named build to be excluded")
+	}
+	if filter.AllowsDir("build/x.txt", false) {
+		t.Error("expected a file under an excluded directory to be excluded")
+	}
+	if filter.AllowsDir("build/sub/x.txt", false) {
+		t.Error("expected a file under a nested excluded directory to be excluded")
+	}
+	if !filter.Allows("builder/x.txt") {
+		t.Error("expected a file under a similarly-named directory to still be allowed")
+	}
+}
+
+// TestPathPatternGitCorpus exercises pattern shapes drawn from git's own
+// ignore-matching test corpus (git's wildmatch and t0008-ignores.sh style
+// cases), restricted to the subset of wildmatch that gitignore/gitattributes
+// patterns use: "*", "?", character classes, "**", anchoring and negation.
+func TestPathPatternGitCorpus(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		// Literal matches.
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"foo", "foobar", false},
+
+		// Single-character and single-segment wildcards.
+		{"?", "a", true},
+		{"?", "ab", false},
+		{"*", "foo", true},
+		{"f*", "foo", true},
+		{"*f", "foo", false},
+		{"*foo*", "xfoox", true},
+		{"*ob*a*r*", "foobar", true},
+		// A slash-less pattern is relative to every directory level, so a
+		// single "*" matches the basename of a nested path too, but "*"
+		// within one segment still can't itself cross a separator.
+		{"*", "foo/bar", true},
+		{"f*r", "foo/bar", false},
+
+		// "**" crosses any number of path separators, including zero.
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/c", false},
+		{"**/b", "a/x/y/b", true},
+		{"a/**", "a/x/y/b", true},
+		{"**", "anything/at/all", true},
+		{"**", "", true},
+
+		// Character classes.
+		{"[abc]", "a", true},
+		{"[abc]", "d", false},
+		{"[a-c]", "b", true},
+		{"[^abc]", "d", true},
+		{"[!abc]", "d", true},
+		{"[!abc]", "a", false},
+
+		// Anchoring.
+		{"/foo", "foo", true},
+		{"/foo", "bar/foo", false},
+		{"foo", "bar/foo", true},
+
+		// Negation is a pattern-list property, not a single-pattern one,
+		// and is covered by TestPathFilterAllows; a bare "!" pattern here
+		// exercises only the per-pattern raw-prefix stripping.
+		{"!foo", "foo", true},
+
+		// Malformed classes must fail closed, never panic.
+		{"file[0-9", "file1", false},
+		{"[", "a", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pattern+" vs "+c.path, func(t *testing.T) {
+			p := compilePattern(c.pattern)
+			if actual := p.Match(c.path, false); actual != c.expected {
+				t.Errorf("compilePattern(%q).Match(%q) = %v, want %v", c.pattern, c.path, actual, c.expected)
+			}
+		})
+	}
+}
+
+// FuzzPathFilterAllows checks that no pattern or path, however malformed,
+// makes PathFilter panic.
+func FuzzPathFilterAllows(f *testing.F) {
+	seeds := []struct {
+		pattern string
+		path    string
+	}{
+		{"*.psd", "a.psd"},
+		{"**/*.psd", "assets/raw/a.psd"},
+		{"a/**/b", "a/x/y/b"},
+		{"!keep.bin", "keep.bin"},
+		{"build/", "build/x.txt"},
+		{"file[0-9].txt", "file1.txt"},
+		{"file[0-9", "file1"},
+		{"[", ""},
+		{"", ""},
+	}
+	for _, s := range seeds {
+		f.Add(s.pattern, s.path)
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, path string) {
+		filter := NewPathFilter([]string{pattern}, nil)
+		filter.Allows(path)
+		filter.AllowsDir(path, true)
+	})
+}
+
+func TestFilenamePassesIncludeExcludeFilter(t *testing.T) {
+	if !FilenamePassesIncludeExcludeFilter("a.txt", nil, nil) {
+		t.Error("expected no filters to always pass")
+	}
+
+	if FilenamePassesIncludeExcludeFilter("a.psd", nil, []string{"**/*.psd"}) {
+		t.Error("expected a.psd to be excluded")
+	}
+}
@@ -1,46 +1,140 @@
 package lfs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
+// ProgressEvent describes a single progress update for a file transfer. It
+// is passed through CopyCallback so that every writer that cares about
+// progress -- the plain-text GIT_LFS_PROGRESS log, the newline-delimited
+// JSON log, and future in-memory aggregators for `git lfs status --watch`
+// -- can be plugged in behind one interface instead of each parsing the
+// callback arguments themselves.
+type ProgressEvent struct {
+	Event      string `json:"event"`
+	Name       string `json:"file"`
+	Index      int    `json:"index"`
+	TotalFiles int    `json:"total_files"`
+	Bytes      int64  `json:"bytes"`
+	TotalBytes int64  `json:"total_bytes"`
+	Time       int64  `json:"ts"`
+}
+
 type CallbackReader struct {
 	C         CopyCallback
 	TotalSize int64
 	ReadSize  int64
+
+	// Ctx, if set, aborts Read with ctx.Err() once it is done.
+	Ctx context.Context
+
+	// Throttle is the minimum amount of time that must pass between two
+	// callback dispatches. Zero means no time-based throttling.
+	Throttle time.Duration
+
+	// ThrottleBytes is the minimum number of bytes that must be read
+	// between two callback dispatches. Zero means no byte-based
+	// throttling.
+	ThrottleBytes int64
+
 	io.Reader
+
+	lastDispatch time.Time
+	lastBytes    int64
+	dispatched   bool
 }
 
-type CopyCallback func(totalSize int64, readSoFar int64, readSinceLast int) error
+type CopyCallback func(event ProgressEvent) error
 
 func (w *CallbackReader) Read(p []byte) (int, error) {
+	if w.Ctx != nil {
+		if err := w.Ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+
 	n, err := w.Reader.Read(p)
 
 	if n > 0 {
 		w.ReadSize += int64(n)
 	}
 
-	if err == nil && w.C != nil {
-		err = w.C(w.TotalSize, w.ReadSize, n)
+	// The read that completes the copy must always dispatch, even if it
+	// would otherwise be throttled, so a consumer never stalls below a
+	// final 100% event. Only the genuinely last read (io.EOF) counts as
+	// final -- reaching TotalSize early, e.g. because it was an estimate,
+	// must not bypass throttling for the rest of the copy.
+	final := err == io.EOF
+
+	// A throttled-then-forced final dispatch can otherwise report the same
+	// ReadSize twice in a row; skip it if nothing changed since the last
+	// dispatch.
+	alreadyReported := w.dispatched && w.ReadSize == w.lastBytes
+
+	if (err == nil || err == io.EOF) && w.C != nil && !alreadyReported && (final || w.shouldDispatch(n)) {
+		cbErr := w.C(ProgressEvent{
+			Bytes:      w.ReadSize,
+			TotalBytes: w.TotalSize,
+		})
+		if err == nil {
+			err = cbErr
+		}
+		w.lastDispatch = time.Now()
+		w.lastBytes = w.ReadSize
+		w.dispatched = true
 	}
 
 	return n, err
 }
 
+// shouldDispatch reports whether a callback should fire for a read of n
+// bytes, given the configured Throttle and ThrottleBytes limits. A read
+// that made no progress never dispatches.
+func (w *CallbackReader) shouldDispatch(n int) bool {
+	if n == 0 {
+		return false
+	}
+
+	if w.Throttle > 0 && !w.lastDispatch.IsZero() && time.Since(w.lastDispatch) < w.Throttle {
+		return false
+	}
+
+	if w.ThrottleBytes > 0 && w.ReadSize-w.lastBytes < w.ThrottleBytes {
+		return false
+	}
+
+	return true
+}
+
 func CopyWithCallback(writer io.Writer, reader io.Reader, totalSize int64, cb CopyCallback) (int64, error) {
+	return CopyWithContext(context.Background(), writer, reader, totalSize, cb, 0, 0)
+}
+
+// CopyWithContext is like CopyWithCallback, but the copy can be aborted via
+// ctx, and callback dispatch can be rate-limited with throttle (a minimum
+// duration between callbacks) and throttleBytes (a minimum number of bytes
+// read between callbacks), so that progress callbacks on many small chunks
+// don't dominate CPU on large files. Either limit may be zero to disable it.
+func CopyWithContext(ctx context.Context, writer io.Writer, reader io.Reader, totalSize int64, cb CopyCallback, throttle time.Duration, throttleBytes int64) (int64, error) {
 	if cb == nil {
 		return io.Copy(writer, reader)
 	}
 
 	cbReader := &CallbackReader{
-		C:         cb,
-		TotalSize: totalSize,
-		Reader:    reader,
+		C:             cb,
+		TotalSize:     totalSize,
+		Ctx:           ctx,
+		Throttle:      throttle,
+		ThrottleBytes: throttleBytes,
+		Reader:        reader,
 	}
 	return io.Copy(writer, cbReader)
 }
@@ -65,16 +159,42 @@ func CopyCallbackFile(event, filename string, index, totalFiles int) (CopyCallba
 		return nil, file, wrapProgressError(err, event, logPath)
 	}
 
+	asJSON := strings.EqualFold(Config.Getenv("GIT_LFS_PROGRESS_FORMAT"), "json")
+	encoder := json.NewEncoder(file)
+
 	var prevWritten int64
+	var lastSync time.Time
 
-	cb := CopyCallback(func(total int64, written int64, current int) error {
-		if written != prevWritten {
-			_, err := file.Write([]byte(fmt.Sprintf("%s %d/%d %d/%d %s\n", event, index, totalFiles, written, total, filename)))
-			file.Sync()
-			prevWritten = written
+	cb := CopyCallback(func(p ProgressEvent) error {
+		if p.Bytes == prevWritten {
+			return nil
+		}
+		prevWritten = p.Bytes
+
+		p.Event = event
+		p.Name = filename
+		p.Index = index
+		p.TotalFiles = totalFiles
+		p.Time = time.Now().Unix()
+
+		var err error
+		if asJSON {
+			err = encoder.Encode(p)
+		} else {
+			_, err = file.Write([]byte(fmt.Sprintf("%s %d/%d %d/%d %s\n", p.Event, p.Index, p.TotalFiles, p.Bytes, p.TotalBytes, p.Name)))
+		}
+		if err != nil {
 			return wrapProgressError(err, event, logPath)
 		}
 
+		// Fsync on a timer rather than on every write, so writing
+		// progress for many small files doesn't turn into a storm of
+		// fsync calls.
+		if time.Since(lastSync) >= time.Second {
+			file.Sync()
+			lastSync = time.Now()
+		}
+
 		return nil
 	})
 
@@ -92,57 +212,13 @@ func wrapProgressError(err error, event, filename string) error {
 // Return whether a given filename passes the include / exclude path filters
 // Only paths that are in includePaths and outside excludePaths are passed
 // If includePaths is empty that filter always passes and the same with excludePaths
-// Both path lists support wildcard matches
+// Patterns are gitignore/gitattributes-compatible: they support "**" globs,
+// a leading "/" anchor, a trailing "/" for directory-only matches, and "!"
+// negation. Callers that filter many paths against the same pattern lists
+// should compile a PathFilter once with NewPathFilter and reuse it instead
+// of calling this function per file.
 func FilenamePassesIncludeExcludeFilter(filename string, includePaths, excludePaths []string) bool {
-	if len(includePaths) == 0 && len(excludePaths) == 0 {
-		return true
-	}
-
-	// For Win32, because git reports files with / separators
-	cleanfilename := filepath.Clean(filename)
-	if len(includePaths) > 0 {
-		matched := false
-		for _, inc := range includePaths {
-			matched, _ = filepath.Match(inc, filename)
-			if !matched && IsWindows() {
-				// Also Win32 match
-				matched, _ = filepath.Match(inc, cleanfilename)
-			}
-			if !matched {
-				// Also support matching a parent directory without a wildcard
-				if strings.HasPrefix(cleanfilename, inc+string(filepath.Separator)) {
-					matched = true
-				}
-			}
-			if matched {
-				break
-			}
-
-		}
-		if !matched {
-			return false
-		}
-	}
-
-	if len(excludePaths) > 0 {
-		for _, ex := range excludePaths {
-			matched, _ := filepath.Match(ex, filename)
-			if !matched && IsWindows() {
-				// Also Win32 match
-				matched, _ = filepath.Match(ex, cleanfilename)
-			}
-			if matched {
-				return false
-			}
-			// Also support matching a parent directory without a wildcard
-			if strings.HasPrefix(cleanfilename, ex+string(filepath.Separator)) {
-				return false
-			}
-
-		}
-	}
-
-	return true
+	return NewPathFilter(includePaths, excludePaths).Allows(filename)
 }
 
 // Are we running on Windows? Need to handle some extra path shenanigans
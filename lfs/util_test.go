@@ -0,0 +1,163 @@
+package lfs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestCallbackReaderDispatchesProgress(t *testing.T) {
+	src := strings.NewReader("hello world")
+	var dst bytes.Buffer
+	var events []ProgressEvent
+
+	n, err := CopyWithCallback(&dst, src, int64(src.Len()), func(e ProgressEvent) error {
+		events = append(events, e)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != int64(len("hello world")) {
+		t.Fatalf("expected to copy %d bytes, got %d", len("hello world"), n)
+	}
+	if len(events) == 0 {
+		t.Fatal("expected at least one progress event")
+	}
+	last := events[len(events)-1]
+	if last.Bytes != n || last.TotalBytes != n {
+		t.Fatalf("expected final event to report %d/%d bytes, got %d/%d", n, n, last.Bytes, last.TotalBytes)
+	}
+}
+
+func TestCallbackReaderAbortsOnCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := strings.NewReader("hello world")
+	var dst bytes.Buffer
+
+	_, err := CopyWithContext(ctx, &dst, src, int64(src.Len()), func(ProgressEvent) error { return nil }, 0, 0)
+	if err != ctx.Err() {
+		t.Fatalf("expected copy to abort with %s, got %s", ctx.Err(), err)
+	}
+}
+
+func TestCallbackReaderThrottlesByBytes(t *testing.T) {
+	src := iotest.OneByteReader(strings.NewReader(strings.Repeat("x", 100)))
+	var dst bytes.Buffer
+	var calls int
+
+	_, err := CopyWithContext(context.Background(), &dst, src, 100, func(ProgressEvent) error {
+		calls++
+		return nil
+	}, 0, 50)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls > 2 {
+		t.Fatalf("expected byte throttling to limit dispatch to at most 2 calls, got %d", calls)
+	}
+}
+
+func TestCallbackReaderThrottlesByTime(t *testing.T) {
+	cbReader := &CallbackReader{
+		TotalSize: 3,
+		Throttle:  time.Hour,
+		Reader:    strings.NewReader("abc"),
+	}
+
+	var calls int
+	cbReader.C = func(ProgressEvent) error {
+		calls++
+		return nil
+	}
+
+	buf := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		if _, err := cbReader.Read(buf); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// The first read dispatches; time throttling holds off every read
+	// after it. None of these reads reach io.EOF, so none of them is the
+	// guaranteed final dispatch either.
+	if calls != 1 {
+		t.Fatalf("expected time throttling to limit dispatch to 1 call, got %d", calls)
+	}
+}
+
+func TestCallbackReaderDispatchesFinalEventDespiteThrottle(t *testing.T) {
+	// Force the copy through many single-byte reads so the real last-data
+	// read is itself throttled, and only the io.EOF read can deliver the
+	// guaranteed final event.
+	src := iotest.OneByteReader(strings.NewReader(strings.Repeat("x", 100)))
+	var dst bytes.Buffer
+	var events []ProgressEvent
+
+	_, err := CopyWithContext(context.Background(), &dst, src, 100, func(e ProgressEvent) error {
+		events = append(events, e)
+		return nil
+	}, time.Hour, 0)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(events) == 0 {
+		t.Fatal("expected at least one progress event despite heavy throttling")
+	}
+	last := events[len(events)-1]
+	if last.Bytes != last.TotalBytes {
+		t.Fatalf("expected final event to report completion (%d/%d), got %d/%d", last.TotalBytes, last.TotalBytes, last.Bytes, last.TotalBytes)
+	}
+}
+
+func TestCallbackReaderDoesNotDuplicateFinalEvent(t *testing.T) {
+	src := iotest.OneByteReader(strings.NewReader("hello world"))
+	var dst bytes.Buffer
+	var events []ProgressEvent
+
+	_, err := CopyWithCallback(&dst, src, int64(len("hello world")), func(e ProgressEvent) error {
+		events = append(events, e)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(events) < 2 {
+		t.Fatalf("expected multiple progress events from a byte-at-a-time read, got %d", len(events))
+	}
+	last := events[len(events)-1]
+	secondToLast := events[len(events)-2]
+	if last == secondToLast {
+		t.Fatalf("expected the io.EOF dispatch not to duplicate the preceding event, got %+v twice", last)
+	}
+}
+
+func TestCallbackReaderDoesNotStormOnUnderestimatedTotalSize(t *testing.T) {
+	// TotalSize is deliberately far smaller than the actual stream length,
+	// simulating a loosely known or underestimated total; reaching it
+	// early must not bypass throttling for the remainder of the copy.
+	src := iotest.OneByteReader(strings.NewReader(strings.Repeat("x", 10)))
+	var dst bytes.Buffer
+	var calls int
+
+	_, err := CopyWithContext(context.Background(), &dst, src, 2, func(ProgressEvent) error {
+		calls++
+		return nil
+	}, time.Hour, 0)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls > 2 {
+		t.Fatalf("expected heavy time throttling to limit dispatch to at most 2 calls (first and final) despite reaching TotalSize early, got %d", calls)
+	}
+}